@@ -7,28 +7,55 @@ package cdb
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"os"
-	"syscall"
 )
 
 const (
 	headerSize = uint32(256 * 8)
+
+	// cdb64HeaderSize is the size, in bytes, of a 64-bit cdb's header:
+	// the cdb64Magic prefix followed by 256 (pos, slots) pairs of uint64s.
+	cdb64HeaderSize = uint64(8 + 256*16)
 )
 
+// cdb64Magic prefixes every 64-bit ("wide") cdb file, the format whose
+// positions and lengths are uint64s and so are not capped at 4 GiB. Writer
+// only produces the classic 32-bit format. Read as the first (pos, slots) pair of a classic 32-bit header, it
+// decodes to a pos of 0xffffffff, larger than any file a 32-bit cdb can
+// address, so the two formats are never ambiguous.
+var cdb64Magic = [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// Cdb reads a cdb database. Its data comes from a reader, which is either
+// a memory-mapped file (Open, New) or a small page cache in front of an
+// arbitrary io.ReaderAt (NewFromReaderAt).
 type Cdb struct {
-	// Slice backed by the mmapped file.
-	mmappedData []byte
+	r reader
+
+	// wide is true for a 64-bit cdb (see cdb64Magic), false for the
+	// classic 32-bit format.
+	wide bool
 }
 
+// Context holds the state of an in-progress lookup. Its fields are wide
+// enough to address both classic 32-bit and wide 64-bit cdb files.
 type Context struct {
-	loop   uint32 // number of hash slots searched under this key
-	khash  uint32 // initialized if loop is nonzero
-	kpos   uint32 // initialized if loop is nonzero
-	hpos   uint32 // initialized if loop is nonzero
-	hslots uint32 // initialized if loop is nonzero
-	dpos   uint32 // initialized if FindNext() returns true
-	dlen   uint32 // initialized if FindNext() returns true
+	loop   uint64 // number of hash slots searched under this key
+	khash  uint64 // initialized if loop is nonzero
+	kpos   uint64 // initialized if loop is nonzero
+	hpos   uint64 // initialized if loop is nonzero
+	hslots uint64 // initialized if loop is nonzero
+	dpos   uint64 // initialized if FindNext() returns true
+	dlen   uint64 // initialized if FindNext() returns true
+}
+
+// newCdb wraps a reader, detecting whether it holds a classic or wide cdb.
+func newCdb(r reader) *Cdb {
+	wide := r.size() >= uint64(len(cdb64Magic)) &&
+		bytes.Equal(r.slice(0, uint64(len(cdb64Magic))), cdb64Magic[:])
+
+	return &Cdb{r: r, wide: wide}
 }
 
 func newWithFile(f *os.File) (*Cdb, error) {
@@ -38,16 +65,12 @@ func newWithFile(f *os.File) (*Cdb, error) {
 		return nil, err
 	}
 
-	// Mmap file.
-	mmappedData, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()),
-		syscall.PROT_READ, syscall.MAP_SHARED)
+	m, err := newMmapReader(f, fi.Size())
 	if err != nil {
 		return nil, err
 	}
 
-	return &Cdb{
-		mmappedData,
-	}, nil
+	return newCdb(m), nil
 }
 
 // Open opens the named file read-only and returns a new Cdb object.  The file
@@ -65,17 +88,28 @@ func Open(name string) (*Cdb, error) {
 }
 
 // Close closes the cdb for any further reads.
-func (c *Cdb) Close() (err error) {
-	// Unmap data.
-	return syscall.Munmap(c.mmappedData)
+func (c *Cdb) Close() error {
+	return c.r.close()
 }
 
-// New creates a new Cdb from the given ReaderAt, which should be a cdb format
-// database.
-func New(r io.ReaderAt) *Cdb {
-	c, _ := newWithFile(r.(*os.File))
+// New creates a new Cdb backed by the given ReaderAt, which should be an
+// *os.File holding a cdb format database; it is mmapped exactly as Open
+// does. For any other io.ReaderAt implementation, use NewFromReaderAt.
+func New(r io.ReaderAt) (*Cdb, error) {
+	f, ok := r.(*os.File)
+	if !ok {
+		return nil, fmt.Errorf("cdb: New requires an *os.File, got %T; use NewFromReaderAt instead", r)
+	}
 
-	return c
+	return newWithFile(f)
+}
+
+// NewFromReaderAt creates a new Cdb backed purely by r, with no mmap
+// involved: an io.SectionReader, a bytes.Reader, or a ReaderAt in front
+// of remote storage all work. Since an io.ReaderAt does not expose its
+// own length, size must be given explicitly.
+func NewFromReaderAt(r io.ReaderAt, size int64) (*Cdb, error) {
+	return newCdb(newReaderAtStore(r, size)), nil
 }
 
 // NewContext returns a new context to be used in CDB calls.
@@ -93,9 +127,7 @@ func (c *Cdb) Data(key []byte, context *Context) ([]byte, error) {
 		return nil, err
 	}
 
-	data := c.mmappedData[context.dpos : context.dpos+context.dlen]
-
-	return data, nil
+	return c.r.slice(context.dpos, context.dlen), nil
 }
 
 // FindStart resets the cdb to search for the first record under a new key.
@@ -110,7 +142,7 @@ func (c *Cdb) FindNext(key []byte, context *Context) ([]byte, error) {
 		return nil, err
 	}
 
-	return c.mmappedData[context.dpos : context.dpos+context.dlen], nil
+	return c.r.slice(context.dpos, context.dlen), nil
 }
 
 // Find returns the first data value for the given key as a byte slice.
@@ -121,46 +153,79 @@ func (c *Cdb) Find(key []byte, context *Context) ([]byte, error) {
 	return c.FindNext(key, context)
 }
 
+// find locates key and, on success, leaves context.dpos/dlen describing
+// its data. Every read along the way is bounds-checked explicitly and
+// reported as a *CorruptError; the recover here is only a last-resort net
+// for a bug slipping through, not the primary error path.
 func (c *Cdb) find(key []byte, context *Context) (err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			err = e.(error)
+			if ce, ok := e.(error); ok {
+				err = ce
+			} else {
+				panic(e)
+			}
 		}
 	}()
 
-	var pos, h uint32
+	klen := uint64(len(key))
+	entryWidth := c.entryWidth()
+
+	var pos uint64
 
-	klen := uint32(len(key))
 	if context.loop == 0 {
-		h = checksum(key)
-		context.hpos, context.hslots = c.readNums((h<<3)&2047,
-			context)
+		h := checksum(key)
+		context.hpos, context.hslots, err = c.readTableHeader(h)
+		if err != nil {
+			return err
+		}
 		if context.hslots == 0 {
 			return io.EOF
 		}
-		context.khash = h
-		h >>= 8
-		h %= context.hslots
-		h <<= 3
-		context.kpos = context.hpos + h
+		// hslots comes straight from the file (a uint64 of it, for a wide
+		// cdb), so hpos+hslots*entryWidth must be checked with fitsWithin
+		// before it's computed directly below: a crafted hslots can
+		// otherwise wrap the multiplication and make the table-end
+		// arithmetic further down unreliable.
+		if !fitsWithin(context.hpos, context.hslots, entryWidth, c.r.size()) {
+			return &CorruptError{Offset: context.hpos, Reason: fmt.Sprintf(
+				"hash table (pos=%d, slots=%d) extends past end of file (%d)", context.hpos, context.hslots, c.r.size())}
+		}
+		context.khash = uint64(h)
+		slot := uint64(h>>8) % context.hslots
+		context.kpos = context.hpos + slot*entryWidth
 	}
 
 	for context.loop < context.hslots {
-		h, pos = c.readNums(context.kpos, context)
+		var rh uint64
+		rh, pos, err = c.readPair(context.kpos)
+		if err != nil {
+			return err
+		}
 		if pos == 0 {
 			return io.EOF
 		}
 		context.loop++
-		context.kpos += 8
-		if context.kpos == context.hpos+(context.hslots<<3) {
+		context.kpos += entryWidth
+		if context.kpos == context.hpos+context.hslots*entryWidth {
 			context.kpos = context.hpos
 		}
-		if h == context.khash {
-			rklen, rdlen := c.readNums(pos, context)
+		if rh == context.khash {
+			rklen, rdlen, err := c.readPair(pos)
+			if err != nil {
+				return err
+			}
 			if rklen == klen {
-				if c.match(key, pos+8) {
+				ok, err := c.match(key, pos+entryWidth)
+				if err != nil {
+					return err
+				}
+				if ok {
+					if err := c.checkBounds(pos+entryWidth+klen, rdlen); err != nil {
+						return err
+					}
 					context.dlen = rdlen
-					context.dpos = pos + 8 + klen
+					context.dpos = pos + entryWidth + klen
 					return nil
 				}
 			}
@@ -170,13 +235,98 @@ func (c *Cdb) find(key []byte, context *Context) (err error) {
 	return io.EOF
 }
 
-func (c *Cdb) match(key []byte, pos uint32) bool {
-	return bytes.Equal(c.mmappedData[pos:pos+uint32(len(key))], key)
+// entryWidth returns the size, in bytes, of a (hash, pos) hash-table
+// entry or a (klen, dlen) record header: 8 for a classic 32-bit cdb, 16
+// for a wide 64-bit one.
+func (c *Cdb) entryWidth() uint64 {
+	if c.wide {
+		return 16
+	}
+
+	return 8
+}
+
+func (c *Cdb) match(key []byte, pos uint64) (bool, error) {
+	if err := c.checkBounds(pos, uint64(len(key))); err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(c.r.slice(pos, uint64(len(key))), key), nil
+}
+
+// readTableHeader reads the (pos, slots) pair for the subtable that key
+// hash h belongs to, out of the 256-entry directory at the start of the
+// file.
+func (c *Cdb) readTableHeader(h uint32) (uint64, uint64, error) {
+	if c.wide {
+		return c.readNums64(8 + uint64(h&0xff)*16)
+	}
+
+	pos, slots, err := c.readNums(uint32(h&0xff) * 8)
+
+	return uint64(pos), uint64(slots), err
 }
 
-func (c *Cdb) readNums(pos uint32, context *Context) (uint32, uint32) {
-	data := c.mmappedData[pos : pos+8]
+// readPair reads a (hash, pos) hash-table entry, or a (klen, dlen) record
+// header, at the given file offset, widening classic 32-bit values to
+// match the wide 64-bit format.
+func (c *Cdb) readPair(pos uint64) (uint64, uint64, error) {
+	if c.wide {
+		return c.readNums64(pos)
+	}
+
+	a, b, err := c.readNums(uint32(pos))
+
+	return uint64(a), uint64(b), err
+}
+
+// fitsWithin reports whether base+count*width does not exceed size,
+// without computing that sum directly: base, count and width can all be
+// attacker-controlled values read straight out of a cdb file, and
+// base+count*width can overflow uint64 and wrap around to something
+// deceptively small. Comparing via subtraction and division instead
+// means the arithmetic here never overflows.
+func fitsWithin(base, count, width, size uint64) bool {
+	if base > size {
+		return false
+	}
+	if width == 0 {
+		return true
+	}
+
+	return count <= (size-base)/width
+}
+
+// checkBounds returns a *CorruptError if the n bytes at pos would read
+// past the end of the file, instead of letting the later slice panic.
+func (c *Cdb) checkBounds(pos, n uint64) error {
+	if !fitsWithin(pos, n, 1, c.r.size()) {
+		return &CorruptError{Offset: pos, Reason: fmt.Sprintf("read of %d bytes exceeds file size %d", n, c.r.size())}
+	}
+
+	return nil
+}
+
+func (c *Cdb) readNums(pos uint32) (uint32, uint32, error) {
+	if err := c.checkBounds(uint64(pos), 8); err != nil {
+		return 0, 0, err
+	}
+
+	data := c.r.slice(uint64(pos), 8)
 
 	return binary.LittleEndian.Uint32(data),
-		binary.LittleEndian.Uint32(data[4:])
+		binary.LittleEndian.Uint32(data[4:]), nil
+}
+
+// readNums64 is the 64-bit sibling of readNums, used once a cdb file has
+// been identified as using the wide record format.
+func (c *Cdb) readNums64(pos uint64) (uint64, uint64, error) {
+	if err := c.checkBounds(pos, 16); err != nil {
+		return 0, 0, err
+	}
+
+	data := c.r.slice(pos, 16)
+
+	return binary.LittleEndian.Uint64(data),
+		binary.LittleEndian.Uint64(data[8:]), nil
 }
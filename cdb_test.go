@@ -0,0 +1,226 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// classicHash is the djb2-variant hash the cdb format (and checksum in
+// hash.go) uses, re-implemented from scratch here so these tests check
+// against the documented format rather than against this package's own
+// code.
+func classicHash(key []byte) uint32 {
+	h := uint32(5381)
+	for _, b := range key {
+		h = ((h << 5) + h) ^ uint32(b)
+	}
+
+	return h
+}
+
+type kv struct {
+	key, value []byte
+}
+
+// encodeClassicCDB builds a classic (32-bit) cdb file from scratch,
+// independently of writer.go, following the same algorithm the reference
+// cdbmake tool uses. Tests that decode its output with this package's
+// Open/Find exercise wire compatibility rather than just round-tripping
+// through our own encoder. (The reference C cdb tool isn't available in
+// this environment, so this stands in for it.)
+func encodeClassicCDB(records []kv) []byte {
+	type slot struct {
+		hash uint32
+		pos  uint32
+	}
+
+	var data bytes.Buffer
+	var buckets [256][]slot
+
+	pos := uint32(2048)
+	for _, r := range records {
+		var lenBuf [8]byte
+		binary.LittleEndian.PutUint32(lenBuf[0:4], uint32(len(r.key)))
+		binary.LittleEndian.PutUint32(lenBuf[4:8], uint32(len(r.value)))
+		data.Write(lenBuf[:])
+		data.Write(r.key)
+		data.Write(r.value)
+
+		h := classicHash(r.key)
+		buckets[h&0xff] = append(buckets[h&0xff], slot{hash: h, pos: pos})
+		pos += 8 + uint32(len(r.key)) + uint32(len(r.value))
+	}
+
+	header := make([]byte, 2048)
+	var tables bytes.Buffer
+
+	for i, bucket := range buckets {
+		nslots := uint32(len(bucket)) * 2
+		table := make([]slot, nslots)
+
+		for _, s := range bucket {
+			si := (s.hash >> 8) % nslots
+			for table[si].pos != 0 {
+				si++
+				if si == nslots {
+					si = 0
+				}
+			}
+			table[si] = s
+		}
+
+		binary.LittleEndian.PutUint32(header[i*8:i*8+4], pos)
+		binary.LittleEndian.PutUint32(header[i*8+4:i*8+8], nslots)
+
+		for _, s := range table {
+			var rec [8]byte
+			binary.LittleEndian.PutUint32(rec[0:4], s.hash)
+			binary.LittleEndian.PutUint32(rec[4:8], s.pos)
+			tables.Write(rec[:])
+			pos += 8
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(header)
+	out.Write(data.Bytes())
+	out.Write(tables.Bytes())
+
+	return out.Bytes()
+}
+
+func writeTempFile(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.cdb")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	return path
+}
+
+func TestOpenReadsIndependentlyEncodedFile(t *testing.T) {
+	records := []kv{
+		{[]byte("one"), []byte("Hello")},
+		{[]byte("two"), []byte("World")},
+		{[]byte("three"), []byte("!!!")},
+	}
+
+	c, err := Open(writeTempFile(t, encodeClassicCDB(records)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	ctx := NewContext()
+	for _, r := range records {
+		got, err := c.Find(r.key, ctx)
+		if err != nil {
+			t.Fatalf("Find(%q): %v", r.key, err)
+		}
+		if !bytes.Equal(got, r.value) {
+			t.Fatalf("Find(%q) = %q, want %q", r.key, got, r.value)
+		}
+	}
+
+	if _, err := c.Find([]byte("missing"), ctx); err != io.EOF {
+		t.Fatalf("Find(missing) = %v, want io.EOF", err)
+	}
+}
+
+func TestFindNextWalksDuplicateKeys(t *testing.T) {
+	records := []kv{
+		{[]byte("dup"), []byte("first")},
+		{[]byte("dup"), []byte("second")},
+	}
+
+	c, err := Open(writeTempFile(t, encodeClassicCDB(records)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	ctx := NewContext()
+
+	first, err := c.Find([]byte("dup"), ctx)
+	if err != nil || !bytes.Equal(first, []byte("first")) {
+		t.Fatalf("first Find = %q, %v", first, err)
+	}
+
+	second, err := c.FindNext([]byte("dup"), ctx)
+	if err != nil || !bytes.Equal(second, []byte("second")) {
+		t.Fatalf("FindNext = %q, %v", second, err)
+	}
+
+	if _, err := c.FindNext([]byte("dup"), ctx); err != io.EOF {
+		t.Fatalf("third FindNext = %v, want io.EOF", err)
+	}
+}
+
+func TestWriterOutputRoundTrips(t *testing.T) {
+	records := []kv{
+		{[]byte("alpha"), []byte("1")},
+		{[]byte("beta"), []byte("22")},
+		{[]byte("gamma"), []byte("333")},
+	}
+
+	path := filepath.Join(t.TempDir(), "written.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, r := range records {
+		if err := w.Put(r.key, r.value); err != nil {
+			t.Fatalf("Put(%q): %v", r.key, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	ctx := NewContext()
+	for _, r := range records {
+		got, err := c.Find(r.key, ctx)
+		if err != nil {
+			t.Fatalf("Find(%q): %v", r.key, err)
+		}
+		if !bytes.Equal(got, r.value) {
+			t.Fatalf("Find(%q) = %q, want %q", r.key, got, r.value)
+		}
+	}
+}
+
+func TestFreezeOpensImmediatelyQueryable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frozen.cdb")
+
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Put([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	c, err := w.Freeze()
+	if err != nil {
+		t.Fatalf("Freeze: %v", err)
+	}
+	defer c.Close()
+
+	got, err := c.Find([]byte("k"), NewContext())
+	if err != nil || !bytes.Equal(got, []byte("v")) {
+		t.Fatalf("Find(k) = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,14 @@
+package cdb
+
+// checksum computes the hash used throughout the cdb file format to map a
+// key to one of the 256 subtables and then to a slot within it. It is the
+// "times 33" hash specified by D. J. Bernstein: start at 5381 and for each
+// byte b of the key set h = ((h<<5)+h) ^ b.
+func checksum(key []byte) uint32 {
+	h := uint32(5381)
+	for _, b := range key {
+		h = ((h << 5) + h) ^ uint32(b)
+	}
+
+	return h
+}
@@ -0,0 +1,109 @@
+package cdb
+
+import "io"
+
+// Iterate walks every record stored in the database, in on-disk order
+// (not hash order), calling fn with each record's key and value. Walking
+// stops, and Iterate returns, as soon as fn returns a non-nil error.
+//
+// Iterate never relies on recovering from a runtime panic: every record
+// it reads is bounds-checked first, so a truncated or corrupt file yields
+// an error (a *CorruptError for a record header or directory entry that
+// does not fit, io.ErrUnexpectedEOF for a key or value that runs past the
+// end of the file) rather than a panic.
+func (c *Cdb) Iterate(fn func(key, value []byte) error) error {
+	end, err := c.dataEnd()
+	if err != nil {
+		return err
+	}
+
+	width := c.entryWidth()
+	size := c.r.size()
+	pos := c.dataStart()
+
+	for pos < end {
+		klen, dlen, err := c.readRecordHeader(pos)
+		if err != nil {
+			return err
+		}
+
+		// keyStart is safe to compute directly: readRecordHeader(pos)
+		// only succeeds once pos+width has already been shown to fit
+		// within the file. klen and dlen, on the other hand, come
+		// straight from the record itself, so each step below is
+		// checked with fitsWithin before the addition that depends on
+		// it is performed.
+		keyStart := pos + width
+		if !fitsWithin(keyStart, klen, 1, size) {
+			return io.ErrUnexpectedEOF
+		}
+
+		valStart := keyStart + klen
+		if !fitsWithin(valStart, dlen, 1, size) {
+			return io.ErrUnexpectedEOF
+		}
+
+		valEnd := valStart + dlen
+
+		if err := fn(c.r.slice(keyStart, klen), c.r.slice(valStart, dlen)); err != nil {
+			return err
+		}
+
+		pos = valEnd
+	}
+
+	return nil
+}
+
+// dataStart returns the file offset where the data region begins: right
+// after the header (and, for a wide cdb, the cdb64Magic prefix).
+func (c *Cdb) dataStart() uint64 {
+	if c.wide {
+		return cdb64HeaderSize
+	}
+
+	return uint64(headerSize)
+}
+
+// dataEnd returns the file offset where the data region ends, i.e. where
+// the first of the 256 hash tables begins. Hash tables are appended
+// sequentially right after the data as the database is built, so this is
+// simply the smallest table position recorded in the directory.
+func (c *Cdb) dataEnd() (uint64, error) {
+	start := c.dataStart()
+	min := c.r.size()
+
+	for i := uint32(0); i < 256; i++ {
+		pos, _, err := c.readDirEntry(i)
+		if err != nil {
+			return 0, err
+		}
+		if pos < min {
+			min = pos
+		}
+	}
+
+	if min < start {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return min, nil
+}
+
+// readDirEntry reads the i'th (pos, slots) pair out of the directory at
+// the start of the file, bounds-checking pos before reading it.
+func (c *Cdb) readDirEntry(i uint32) (uint64, uint64, error) {
+	base := uint64(0)
+	if c.wide {
+		base = 8
+	}
+
+	return c.readRecordHeader(base + uint64(i)*c.entryWidth())
+}
+
+// readRecordHeader reads the (klen, dlen) pair (or, when reused for the
+// directory, the (pos, slots) pair) at the given offset, returning an
+// error instead of panicking if it would read past the end of the file.
+func (c *Cdb) readRecordHeader(pos uint64) (uint64, uint64, error) {
+	return c.readPair(pos)
+}
@@ -0,0 +1,43 @@
+package cdb
+
+import (
+	"os"
+	"syscall"
+)
+
+// reader is the storage abstraction behind Cdb: either a memory-mapped
+// file or a small LRU page cache in front of an arbitrary io.ReaderAt
+// (see readerAtStore).
+//
+// slice returns the n bytes at pos, panicking if they cannot be read —
+// find() recovers from that panic and turns it into an error, exactly as
+// it has always done for a corrupt mmapped file. For a mmap-backed
+// reader the returned slice is a direct view into the mapping and safe
+// to retain until close unmaps it; for a cache-backed reader it is a freshly
+// copied buffer. Either way, callers never need to special-case which
+// kind of reader they have.
+type reader interface {
+	slice(pos, n uint64) []byte
+	size() uint64
+	close() error
+}
+
+// mmapReader is a reader backed by a memory-mapped *os.File, the storage
+// used by Open and by New for *os.File arguments.
+type mmapReader struct {
+	data []byte
+}
+
+func newMmapReader(f *os.File, size int64) (*mmapReader, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size),
+		syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mmapReader{data: data}, nil
+}
+
+func (r *mmapReader) slice(pos, n uint64) []byte { return r.data[pos : pos+n] }
+func (r *mmapReader) size() uint64               { return uint64(len(r.data)) }
+func (r *mmapReader) close() error               { return syscall.Munmap(r.data) }
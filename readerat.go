@@ -0,0 +1,112 @@
+package cdb
+
+import (
+	"io"
+	"sync"
+)
+
+// readerAtPageSize is the granularity at which readerAtStore caches reads
+// from its backing io.ReaderAt. A lookup touches a handful of small
+// entries within the same subtable, so caching whole pages turns what
+// would be several underlying reads into one.
+const readerAtPageSize = 4096
+
+// readerAtMaxPages bounds how many pages readerAtStore keeps cached at
+// once; the least recently used page is evicted once the bound is hit.
+const readerAtMaxPages = 256
+
+// readerAtStore is a reader backed by an arbitrary io.ReaderAt — anything
+// that isn't a mmappable *os.File, such as an io.SectionReader, a
+// bytes.Reader, or a ReaderAt in front of remote storage. It has no
+// persistent mapping, so it keeps a small LRU cache of pages read off the
+// backend.
+type readerAtStore struct {
+	r  io.ReaderAt
+	sz int64
+
+	mu    sync.Mutex
+	pages map[int64][]byte
+	lru   []int64 // oldest first
+}
+
+func newReaderAtStore(r io.ReaderAt, size int64) *readerAtStore {
+	return &readerAtStore{r: r, sz: size, pages: make(map[int64][]byte)}
+}
+
+func (s *readerAtStore) slice(pos, n uint64) []byte {
+	if !fitsWithin(pos, n, 1, uint64(s.sz)) {
+		panic(io.ErrUnexpectedEOF)
+	}
+
+	buf := make([]byte, n)
+
+	for read := uint64(0); read < n; {
+		abs := pos + read
+		page := s.page(int64(abs) / readerAtPageSize)
+		off := int(abs) % readerAtPageSize
+		read += uint64(copy(buf[read:], page[off:]))
+	}
+
+	return buf
+}
+
+// page returns the cached contents of the n'th readerAtPageSize-sized
+// page, reading it from the backing ReaderAt on a cache miss. A Cdb is
+// meant for concurrent use by multiple callers sharing one Context each,
+// so pages/lru are guarded by mu rather than assuming single-threaded
+// access the way the mmap-backed reader can (its backing slice never
+// changes after mapping).
+func (s *readerAtStore) page(n int64) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if page, ok := s.pages[n]; ok {
+		s.touch(n)
+		return page
+	}
+
+	start := n * readerAtPageSize
+	length := int64(readerAtPageSize)
+	if start+length > s.sz {
+		length = s.sz - start
+	}
+
+	page := make([]byte, length)
+	if _, err := s.r.ReadAt(page, start); err != nil && err != io.EOF {
+		panic(err)
+	}
+
+	if len(s.pages) >= readerAtMaxPages {
+		s.evictOldest()
+	}
+
+	s.pages[n] = page
+	s.lru = append(s.lru, n)
+
+	return page
+}
+
+// touch and evictOldest assume s.mu is already held by the caller.
+func (s *readerAtStore) touch(n int64) {
+	for i, p := range s.lru {
+		if p == n {
+			s.lru = append(s.lru[:i], s.lru[i+1:]...)
+			break
+		}
+	}
+
+	s.lru = append(s.lru, n)
+}
+
+func (s *readerAtStore) evictOldest() {
+	if len(s.lru) == 0 {
+		return
+	}
+
+	oldest := s.lru[0]
+	s.lru = s.lru[1:]
+	delete(s.pages, oldest)
+}
+
+func (s *readerAtStore) size() uint64 { return uint64(s.sz) }
+func (s *readerAtStore) close() error { return nil }
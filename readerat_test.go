@@ -0,0 +1,79 @@
+package cdb
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestNewFromReaderAtRoundTrips(t *testing.T) {
+	records := []kv{
+		{[]byte("one"), []byte("Hello")},
+		{[]byte("two"), []byte("World")},
+		{[]byte("three"), []byte("!!!")},
+	}
+
+	data := encodeClassicCDB(records)
+
+	c, err := NewFromReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewFromReaderAt: %v", err)
+	}
+	defer c.Close()
+
+	ctx := NewContext()
+	for _, r := range records {
+		got, err := c.Find(r.key, ctx)
+		if err != nil {
+			t.Fatalf("Find(%q): %v", r.key, err)
+		}
+		if !bytes.Equal(got, r.value) {
+			t.Fatalf("Find(%q) = %q, want %q", r.key, got, r.value)
+		}
+	}
+}
+
+// TestNewFromReaderAtConcurrentFind exercises the documented usage
+// pattern of one *Cdb shared across goroutines, each with its own
+// *Context. Run with -race: readerAtStore's page cache used to mutate
+// its map and LRU slice with no synchronization, so this would trip the
+// race detector before that cache was guarded by a mutex.
+func TestNewFromReaderAtConcurrentFind(t *testing.T) {
+	records := make([]kv, 0, 64)
+	for i := 0; i < 64; i++ {
+		records = append(records, kv{
+			key:   []byte{byte(i), byte(i >> 8)},
+			value: bytes.Repeat([]byte{byte(i)}, 8),
+		})
+	}
+
+	data := encodeClassicCDB(records)
+
+	c, err := NewFromReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewFromReaderAt: %v", err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := NewContext()
+			for _, r := range records {
+				got, err := c.Find(r.key, ctx)
+				if err != nil {
+					t.Errorf("Find(%v): %v", r.key, err)
+					return
+				}
+				if !bytes.Equal(got, r.value) {
+					t.Errorf("Find(%v) = %q, want %q", r.key, got, r.value)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,123 @@
+package cdb
+
+import "fmt"
+
+// CorruptError reports that a cdb file is malformed: a directory entry,
+// hash slot, or record does not fit within the file, or a record's key
+// does not hash back to the slot it was found under.
+type CorruptError struct {
+	Offset uint64 // file offset at which the problem was found
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("cdb: corrupt database at offset %d: %s", e.Offset, e.Reason)
+}
+
+// OpenStrict is like Open, but immediately calls Validate on the result,
+// closing the file and returning the error if its header is malformed.
+// Use it whenever the file might not be trusted: it turns what would
+// otherwise be a lazily-discovered corruption failure, on the first Find
+// that happens to touch the bad table, into an upfront one.
+func OpenStrict(name string) (*Cdb, error) {
+	c, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Validate walks the 256-entry hash table directory and confirms every
+// (hpos, hslots) pair describes a table that both starts at or after the
+// data region and fits entirely within the file. It does not otherwise
+// inspect records or hash slots; see Verify for a full pass over those.
+func (c *Cdb) Validate() error {
+	start := c.dataStart()
+	size := c.r.size()
+	width := c.entryWidth()
+
+	for i := uint32(0); i < 256; i++ {
+		hpos, hslots, err := c.readDirEntry(i)
+		if err != nil {
+			return err
+		}
+
+		if hpos < start {
+			return &CorruptError{Offset: hpos, Reason: fmt.Sprintf(
+				"hash table %d starts at %d, before the data region (%d)", i, hpos, start)}
+		}
+
+		if !fitsWithin(hpos, hslots, width, size) {
+			return &CorruptError{Offset: hpos, Reason: fmt.Sprintf(
+				"hash table %d (pos=%d, slots=%d) extends past end of file (%d)", i, hpos, hslots, size)}
+		}
+	}
+
+	return nil
+}
+
+// Verify opens the cdb file at path and walks it end to end: every
+// record in the data region must decode cleanly, and every occupied
+// hash slot in all 256 tables must point to a well-formed record whose
+// key hashes back to the hash stored in that slot. It returns the first
+// problem found, or nil if the file is well-formed: a *CorruptError, or
+// io.ErrUnexpectedEOF for a data-region record whose key or value runs
+// past the end of the file.
+func Verify(path string) error {
+	c, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Iterate(func(key, value []byte) error { return nil }); err != nil {
+		return err
+	}
+
+	width := c.entryWidth()
+
+	for i := uint32(0); i < 256; i++ {
+		hpos, hslots, err := c.readDirEntry(i)
+		if err != nil {
+			return err
+		}
+
+		for s := uint64(0); s < hslots; s++ {
+			slotPos := hpos + s*width
+
+			h, pos, err := c.readPair(slotPos)
+			if err != nil {
+				return err
+			}
+			if pos == 0 {
+				continue
+			}
+
+			klen, _, err := c.readPair(pos)
+			if err != nil {
+				return err
+			}
+
+			if err := c.checkBounds(pos+width, klen); err != nil {
+				return err
+			}
+
+			if uint64(checksum(c.r.slice(pos+width, klen))) != h {
+				return &CorruptError{Offset: slotPos, Reason: fmt.Sprintf(
+					"hash table %d slot %d: key at %d does not hash back to the slot's stored hash", i, s, pos)}
+			}
+		}
+	}
+
+	return nil
+}
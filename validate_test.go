@@ -0,0 +1,135 @@
+package cdb
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// findOccupiedBucket decodes the 256-entry directory of an
+// encodeClassicCDB-produced file and returns the index, hpos and hslots
+// of the first (lowest-index) subtable that actually holds records.
+func findOccupiedBucket(t *testing.T, data []byte) (i int, hpos, hslots uint32) {
+	t.Helper()
+
+	for i := 0; i < 256; i++ {
+		hpos = binary.LittleEndian.Uint32(data[i*8 : i*8+4])
+		hslots = binary.LittleEndian.Uint32(data[i*8+4 : i*8+8])
+		if hslots > 0 {
+			return i, hpos, hslots
+		}
+	}
+
+	t.Fatal("no occupied hash table found")
+
+	return 0, 0, 0
+}
+
+func TestFindReturnsCorruptErrorOnTruncatedRecord(t *testing.T) {
+	key := []byte("k")
+	h := classicHash(key)
+	bucket := h & 0xff
+
+	header := make([]byte, 2048)
+	binary.LittleEndian.PutUint32(header[bucket*8:bucket*8+4], 2048)
+	binary.LittleEndian.PutUint32(header[bucket*8+4:bucket*8+8], 1)
+
+	var buf []byte
+	buf = append(buf, header...)
+
+	// One hash-table slot pointing at the record that follows it.
+	var slot [8]byte
+	binary.LittleEndian.PutUint32(slot[0:4], h)
+	binary.LittleEndian.PutUint32(slot[4:8], 2056)
+	buf = append(buf, slot[:]...)
+
+	// The record header claims a 5-byte value, but the file is cut off
+	// after only 2 bytes of it.
+	var recHeader [8]byte
+	binary.LittleEndian.PutUint32(recHeader[0:4], uint32(len(key)))
+	binary.LittleEndian.PutUint32(recHeader[4:8], 5)
+	buf = append(buf, recHeader[:]...)
+	buf = append(buf, key...)
+	buf = append(buf, []byte("ab")...)
+
+	c, err := Open(writeTempFile(t, buf))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	_, err = c.Find(key, NewContext())
+	if _, ok := err.(*CorruptError); !ok {
+		t.Fatalf("Find on truncated record = %v (%T), want *CorruptError", err, err)
+	}
+}
+
+func TestValidateReturnsCorruptErrorOnOutOfRangeHashTable(t *testing.T) {
+	records := []kv{
+		{[]byte("alpha"), []byte("1")},
+		{[]byte("beta"), []byte("22")},
+	}
+
+	data := encodeClassicCDB(records)
+	i, hpos, _ := findOccupiedBucket(t, data)
+
+	// Claim the table has far more slots than could possibly fit.
+	binary.LittleEndian.PutUint32(data[i*8+4:i*8+8], 0xffffffff)
+
+	path := writeTempFile(t, data)
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	vErr := c.Validate()
+	ce, ok := vErr.(*CorruptError)
+	if !ok {
+		t.Fatalf("Validate = %v, want *CorruptError", vErr)
+	}
+	if ce.Offset != uint64(hpos) {
+		t.Fatalf("CorruptError.Offset = %d, want %d", ce.Offset, hpos)
+	}
+
+	if err := Verify(path); err == nil {
+		t.Fatal("Verify accepted a file with an out-of-range hash table")
+	}
+}
+
+func TestVerifyReturnsCorruptErrorOnHashMismatch(t *testing.T) {
+	records := []kv{{[]byte("k"), []byte("v")}}
+
+	data := encodeClassicCDB(records)
+	_, hpos, hslots := findOccupiedBucket(t, data)
+
+	found := false
+	for s := uint32(0); s < hslots; s++ {
+		slotPos := hpos + s*8
+		pos := binary.LittleEndian.Uint32(data[slotPos+4 : slotPos+8])
+		if pos == 0 {
+			continue
+		}
+
+		// Corrupt the stored hash so it no longer matches the key it
+		// points at.
+		h := binary.LittleEndian.Uint32(data[slotPos : slotPos+4])
+		binary.LittleEndian.PutUint32(data[slotPos:slotPos+4], h+1)
+		found = true
+		break
+	}
+	if !found {
+		t.Fatal("no occupied slot found to corrupt")
+	}
+
+	path := writeTempFile(t, data)
+
+	err := Verify(path)
+	ce, ok := err.(*CorruptError)
+	if !ok {
+		t.Fatalf("Verify = %v, want *CorruptError", err)
+	}
+	if ce.Reason == "" {
+		t.Fatal("CorruptError has no reason")
+	}
+}
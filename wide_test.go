@@ -0,0 +1,154 @@
+package cdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// encodeWideCDB builds a 64-bit ("wide") cdb file from scratch, mirroring
+// encodeClassicCDB but with the cdb64Magic prefix and 64-bit fields. This
+// is what actually exercises the wide code path in cdb.go/iterate.go/
+// validate.go: nothing in this package's own Writer can produce one yet,
+// so without a fixture like this the reader side would be untested.
+func encodeWideCDB(records []kv) []byte {
+	type slot struct {
+		hash uint64
+		pos  uint64
+	}
+
+	const headerLen = uint64(256 * 16)
+	dataStart := uint64(len(cdb64Magic)) + headerLen
+
+	var data bytes.Buffer
+	var buckets [256][]slot
+
+	pos := dataStart
+	for _, r := range records {
+		var lenBuf [16]byte
+		binary.LittleEndian.PutUint64(lenBuf[0:8], uint64(len(r.key)))
+		binary.LittleEndian.PutUint64(lenBuf[8:16], uint64(len(r.value)))
+		data.Write(lenBuf[:])
+		data.Write(r.key)
+		data.Write(r.value)
+
+		h := uint64(classicHash(r.key))
+		buckets[h&0xff] = append(buckets[h&0xff], slot{hash: h, pos: pos})
+		pos += 16 + uint64(len(r.key)) + uint64(len(r.value))
+	}
+
+	header := make([]byte, headerLen)
+	var tables bytes.Buffer
+
+	for i, bucket := range buckets {
+		nslots := uint64(len(bucket)) * 2
+		table := make([]slot, nslots)
+
+		for _, s := range bucket {
+			si := (s.hash >> 8) % nslots
+			for table[si].pos != 0 {
+				si++
+				if si == nslots {
+					si = 0
+				}
+			}
+			table[si] = s
+		}
+
+		binary.LittleEndian.PutUint64(header[i*16:i*16+8], pos)
+		binary.LittleEndian.PutUint64(header[i*16+8:i*16+16], nslots)
+
+		for _, s := range table {
+			var rec [16]byte
+			binary.LittleEndian.PutUint64(rec[0:8], s.hash)
+			binary.LittleEndian.PutUint64(rec[8:16], s.pos)
+			tables.Write(rec[:])
+			pos += 16
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(cdb64Magic[:])
+	out.Write(header)
+	out.Write(data.Bytes())
+	out.Write(tables.Bytes())
+
+	return out.Bytes()
+}
+
+func TestOpenDetectsAndReadsWideFormat(t *testing.T) {
+	records := []kv{
+		{[]byte("wide-one"), []byte("Hello")},
+		{[]byte("wide-two"), []byte("World, at scale")},
+	}
+
+	c, err := Open(writeTempFile(t, encodeWideCDB(records)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	if !c.wide {
+		t.Fatalf("Open did not detect the wide (64-bit) format")
+	}
+
+	ctx := NewContext()
+	for _, r := range records {
+		got, err := c.Find(r.key, ctx)
+		if err != nil {
+			t.Fatalf("Find(%q): %v", r.key, err)
+		}
+		if !bytes.Equal(got, r.value) {
+			t.Fatalf("Find(%q) = %q, want %q", r.key, got, r.value)
+		}
+	}
+}
+
+func TestIterateWalksWideFile(t *testing.T) {
+	records := []kv{
+		{[]byte("a"), []byte("1")},
+		{[]byte("b"), []byte("2")},
+		{[]byte("c"), []byte("3")},
+	}
+
+	c, err := Open(writeTempFile(t, encodeWideCDB(records)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	seen := map[string]string{}
+	if err := c.Iterate(func(key, value []byte) error {
+		seen[string(key)] = string(value)
+		return nil
+	}); err != nil {
+		t.Fatalf("Iterate: %v", err)
+	}
+
+	if len(seen) != len(records) {
+		t.Fatalf("Iterate saw %d records, want %d", len(seen), len(records))
+	}
+	for _, r := range records {
+		if seen[string(r.key)] != string(r.value) {
+			t.Fatalf("Iterate missed or mismatched %q", r.key)
+		}
+	}
+}
+
+func TestVerifyAndValidateAcceptWideFile(t *testing.T) {
+	path := writeTempFile(t, encodeWideCDB([]kv{{[]byte("k"), []byte("v")}}))
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	if err := Verify(path); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
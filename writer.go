@@ -0,0 +1,142 @@
+package cdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// slot is one entry recorded for a key while the database is being built.
+// It is later placed into the on-disk hash table for its subtable.
+type slot struct {
+	hash uint32
+	pos  uint32
+}
+
+// Writer builds a cdb file on disk. Records passed to Put are streamed
+// out immediately; the 256 hash tables and the header are written only
+// once the writer is closed, since their contents depend on every record
+// added up to that point.
+type Writer struct {
+	f       *os.File
+	w       *bufio.Writer
+	pos     uint32
+	buckets [256][]slot
+}
+
+// Create creates a new cdb file at path and returns a Writer ready to
+// accept records via Put. If a file already exists at path it is
+// truncated.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reserve space for the header. It is backfilled with the (pos,
+	// slots) pair for each subtable once Close knows where they landed.
+	if _, err := f.Seek(int64(headerSize), io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Writer{
+		f:   f,
+		w:   bufio.NewWriter(f),
+		pos: headerSize,
+	}, nil
+}
+
+// Put appends a key/value record to the database. Keys are not required
+// to be unique; as with the reference cdb implementation, a later Put for
+// the same key does not remove earlier records, it only adds another one
+// that Find/FindNext will see after the earlier ones.
+func (w *Writer) Put(key, value []byte) error {
+	var lenBuf [8]byte
+	binary.LittleEndian.PutUint32(lenBuf[0:4], uint32(len(key)))
+	binary.LittleEndian.PutUint32(lenBuf[4:8], uint32(len(value)))
+
+	if _, err := w.w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(key); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(value); err != nil {
+		return err
+	}
+
+	h := checksum(key)
+	w.buckets[h&0xff] = append(w.buckets[h&0xff], slot{hash: h, pos: w.pos})
+	w.pos += 8 + uint32(len(key)) + uint32(len(value))
+
+	return nil
+}
+
+// Close flushes any buffered records, appends the 256 hash tables and
+// backfills the header with their positions, then closes the underlying
+// file. The resulting file can be opened with Open.
+func (w *Writer) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+
+	header := make([]byte, headerSize)
+
+	for i, bucket := range w.buckets {
+		nslots := uint32(len(bucket)) * 2
+		table := make([]slot, nslots)
+
+		for _, s := range bucket {
+			si := (s.hash >> 8) % nslots
+			for table[si].pos != 0 {
+				si++
+				if si == nslots {
+					si = 0
+				}
+			}
+			table[si] = s
+		}
+
+		binary.LittleEndian.PutUint32(header[i*8:i*8+4], w.pos)
+		binary.LittleEndian.PutUint32(header[i*8+4:i*8+8], nslots)
+
+		var rec [8]byte
+		for _, s := range table {
+			binary.LittleEndian.PutUint32(rec[0:4], s.hash)
+			binary.LittleEndian.PutUint32(rec[4:8], s.pos)
+			if _, err := w.w.Write(rec[:]); err != nil {
+				w.f.Close()
+				return err
+			}
+			w.pos += 8
+		}
+	}
+
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+
+	if _, err := w.f.WriteAt(header, 0); err != nil {
+		w.f.Close()
+		return err
+	}
+
+	return w.f.Close()
+}
+
+// Freeze closes the writer, exactly like Close, and reopens the resulting
+// file for reading so callers can go straight from building a database to
+// querying it.
+func (w *Writer) Freeze() (*Cdb, error) {
+	path := w.f.Name()
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return Open(path)
+}